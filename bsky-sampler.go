@@ -3,15 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Backoff used while paginating an author's full history on startup;
+// transient fetch errors are retried rather than aborting the backfill.
+const (
+	backfillInitialBackoff = 2 * time.Second
+	backfillMaxBackoff     = 60 * time.Second
 )
 
 // Struct with "text", "timestamp", "uri"
@@ -54,11 +66,30 @@ type BlueskyFetcher struct {
 	ctx    context.Context
 	did    string
 	handle string
-	posts  *MaxHeap
+
+	mu        sync.RWMutex
+	posts     *MaxHeap
+	streaming bool // true while the Jetstream ingester holds a live connection
+
+	// latestTimestamp is the CreatedAt of the newest post addPost has ever
+	// seen. posts itself isn't kept in any particular order (MaxHeap.Push
+	// just appends), so checkForNewPosts can't rely on index 0 being the
+	// newest - this is tracked explicitly instead.
+	latestTimestamp string
+
+	store    PostStore
+	notifier Notifier
+
+	// recencyTree/recencyWeights back the RecencyWeighted sampling
+	// strategy; both stay index-aligned with posts and are guarded by mu.
+	recencyTree    *fenwickTree
+	recencyWeights []float64
+	recencyLambda  float64
 }
 
-// NewBlueskyFetcher creates a new BlueskyFetcher instance
-func NewBlueskyFetcher(handle string) (*BlueskyFetcher, error) {
+// NewBlueskyFetcher creates a new BlueskyFetcher instance backed by store
+// for persistence.
+func NewBlueskyFetcher(handle string, store PostStore) (*BlueskyFetcher, error) {
 	client := &xrpc.Client{
 		Host: "https://public.api.bsky.app",
 	}
@@ -76,15 +107,128 @@ func NewBlueskyFetcher(handle string) (*BlueskyFetcher, error) {
 		did:    did,
 		handle: handle,
 		posts:  &MaxHeap{},
+		store:  store,
+
+		notifier: nopNotifier{},
+
+		recencyTree:   newFenwickTree(),
+		recencyLambda: defaultRecencyLambda,
 	}
 
 	return fetcher, nil
 }
 
+// SetNotifier wires a Notifier into the fetcher; until this is called,
+// newly observed posts simply aren't published anywhere.
+func (bf *BlueskyFetcher) SetNotifier(notifier Notifier) {
+	bf.notifier = notifier
+}
+
+// loadFromStore seeds the in-memory heap from whatever this did already has
+// persisted, so restarts don't start sampling from an empty heap while the
+// backfill walk is still catching up.
+func (bf *BlueskyFetcher) loadFromStore() error {
+	posts, err := bf.store.ByDid(bf.did)
+	if err != nil {
+		return fmt.Errorf("loading posts from store: %w", err)
+	}
+	for _, post := range posts {
+		bf.addPost(post)
+	}
+	return nil
+}
+
+// backfillHistory paginates through the author's entire feed via the
+// cursor field, persisting every post we don't already have, resuming from
+// wherever a prior run left off. Progress (furthest cursor reached, and
+// whether the walk has reached the account's earliest post) is persisted
+// after every page, so a restart mid-backfill picks back up instead of
+// re-fetching page 1 and stopping the instant it matches a post the hourly
+// poll already keeps in the store.
+func (bf *BlueskyFetcher) backfillHistory() error {
+	progress, err := bf.store.BackfillProgress(bf.did)
+	if err != nil {
+		return fmt.Errorf("loading backfill progress: %w", err)
+	}
+	if progress.Complete {
+		return nil
+	}
+	cursor := progress.Cursor
+	backoff := backfillInitialBackoff
+
+	for {
+		feed, err := bsky.FeedGetAuthorFeed(bf.ctx, bf.client, bf.did, cursor, "posts_no_replies", false, 100)
+		if err != nil {
+			if backoff > backfillMaxBackoff {
+				return fmt.Errorf("backfilling history: %w", err)
+			}
+			log.Printf("backfill: transient error fetching feed, retrying in %s: %v", backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		backoff = backfillInitialBackoff
+
+		if err := bf.ingestBackfillPage(feed.Feed); err != nil {
+			return err
+		}
+
+		done := feed.Cursor == nil || *feed.Cursor == "" || len(feed.Feed) == 0
+		if !done {
+			cursor = *feed.Cursor
+		}
+		if err := bf.store.SetBackfillProgress(bf.did, BackfillProgress{Cursor: cursor, Complete: done}); err != nil {
+			return fmt.Errorf("persisting backfill progress: %w", err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// ingestBackfillPage persists and heap-loads one page of the author feed,
+// skipping posts the store already has.
+func (bf *BlueskyFetcher) ingestBackfillPage(feed []*bsky.FeedDefs_FeedViewPost) error {
+	for _, item := range feed {
+		if item.Post.Author.Did != bf.did {
+			continue
+		}
+
+		have, err := bf.store.Has(item.Post.Uri)
+		if err != nil {
+			return fmt.Errorf("checking post store: %w", err)
+		}
+		if have {
+			continue
+		}
+
+		feedPost, ok := item.Post.Record.Val.(*bsky.FeedPost)
+		if !ok {
+			continue
+		}
+		postData := PostData{
+			Text:      feedPost.Text,
+			Timestamp: feedPost.CreatedAt,
+			Uri:       item.Post.Uri,
+		}
+		if err := bf.store.Put(bf.did, postData); err != nil {
+			return fmt.Errorf("persisting post: %w", err)
+		}
+		bf.addPost(postData)
+	}
+	return nil
+}
+
 // getHandleDid resolves a Bluesky handle to a DiD
 func getHandleDid(ctx context.Context, client *xrpc.Client, handle string) (string, error) {
 	resolveResp, err := atproto.IdentityResolveHandle(ctx, client, handle)
-	return resolveResp.Did, err
+	if err != nil {
+		return "", err
+	}
+	if resolveResp == nil {
+		return "", fmt.Errorf("resolving handle %s: empty response", handle)
+	}
+	return resolveResp.Did, nil
 }
 
 // getDidPostList fetches the most recent posts from a given Bluesky handle.
@@ -112,6 +256,7 @@ func (bf *BlueskyFetcher) updatePosts() error {
 		return fmt.Errorf("error fetching posts: %w", err)
 	}
 	fmt.Printf("Number of posts fetched: %d\n", len(postList))
+
 	for _, post := range postList {
 		feedPost := post.Record.Val.(*bsky.FeedPost)
 		postData := PostData{
@@ -119,7 +264,7 @@ func (bf *BlueskyFetcher) updatePosts() error {
 			Timestamp: feedPost.CreatedAt,
 			Uri:       post.Uri,
 		}
-		bf.posts.Push(postData)
+		bf.ingestPost(postData)
 	}
 	return nil
 }
@@ -127,7 +272,12 @@ func (bf *BlueskyFetcher) updatePosts() error {
 // checkForNewPosts checks if there are new posts since the last update.
 // If there are new posts, it updates the global post list.
 func (bf *BlueskyFetcher) checkForNewPosts() error {
-	if bf.posts.Len() == 0 {
+	bf.mu.RLock()
+	empty := bf.posts.Len() == 0
+	latest := bf.latestTimestamp
+	bf.mu.RUnlock()
+
+	if empty {
 		return bf.updatePosts()
 	}
 
@@ -141,7 +291,7 @@ func (bf *BlueskyFetcher) checkForNewPosts() error {
 	}
 
 	recentPost := postList[0].Record.Val.(*bsky.FeedPost)
-	if recentPost.CreatedAt <= bf.posts.Get(0).Timestamp {
+	if recentPost.CreatedAt <= latest {
 		return nil
 	}
 
@@ -149,8 +299,18 @@ func (bf *BlueskyFetcher) checkForNewPosts() error {
 	return bf.updatePosts()
 }
 
+// Len reports how many posts this fetcher currently holds in memory.
+func (bf *BlueskyFetcher) Len() int {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	return bf.posts.Len()
+}
+
 // getRandomPost returns a random post from the heap
 func (bf *BlueskyFetcher) getRandomPost() (PostData, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
 	if bf.posts.Len() == 0 {
 		return PostData{}, fmt.Errorf("no posts available")
 	}
@@ -159,13 +319,169 @@ func (bf *BlueskyFetcher) getRandomPost() (PostData, error) {
 	return bf.posts.Get(randomIndex), nil
 }
 
-// startPeriodicUpdates starts a goroutine that periodically checks for new posts
+// getRandomPostRecencyWeighted draws a post with probability proportional
+// to exp(-lambda*ageDays), instead of sampling uniformly. lambda is a
+// per-request parameter (the ?halflife= query param): when it matches
+// bf.recencyLambda - the default half-life the hourly re-aging pass keeps
+// the shared Fenwick tree built for - that tree answers the draw in
+// O(log n) under a read lock. Anything else scores weights for this call
+// only, so two clients alternating half-lives never force each other to
+// rebuild (and serialize behind a writer lock on) shared fetcher state.
+func (bf *BlueskyFetcher) getRandomPostRecencyWeighted(lambda float64) (PostData, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	if bf.posts.Len() == 0 {
+		return PostData{}, fmt.Errorf("no posts available")
+	}
+
+	if lambda == bf.recencyLambda {
+		total := bf.recencyTree.total()
+		if total <= 0 {
+			return bf.posts.Get(rand.Intn(bf.posts.Len())), nil
+		}
+		index := bf.recencyTree.findByWeight(rand.Float64() * total)
+		return bf.posts.Get(index), nil
+	}
+
+	return bf.sampleByLambdaLocked(lambda), nil
+}
+
+// sampleByLambdaLocked draws a post weighted by recencyWeight at an
+// arbitrary lambda without touching bf.recencyTree/bf.recencyWeights.
+// Callers must hold at least bf.mu's read lock.
+func (bf *BlueskyFetcher) sampleByLambdaLocked(lambda float64) PostData {
+	now := time.Now()
+	n := bf.posts.Len()
+	weights := make([]float64, n)
+	var total float64
+	for i := range weights {
+		weights[i] = recencyWeight(bf.posts.Get(i), now, lambda)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return bf.posts.Get(rand.Intn(n))
+	}
+
+	target := rand.Float64() * total
+	for i, weight := range weights {
+		target -= weight
+		if target <= 0 {
+			return bf.posts.Get(i)
+		}
+	}
+	return bf.posts.Get(n - 1)
+}
+
+// addPost inserts a post into the heap, skipping it if we already have it
+// (the poller, the backfill walk, and the firehose can all race on the
+// same post). Reports whether the post was newly added.
+func (bf *BlueskyFetcher) addPost(post PostData) bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	for i := 0; i < bf.posts.Len(); i++ {
+		if bf.posts.Get(i).Uri == post.Uri {
+			return false
+		}
+	}
+	bf.posts.Push(post)
+	if post.Timestamp > bf.latestTimestamp {
+		bf.latestTimestamp = post.Timestamp
+	}
+
+	weight := recencyWeight(post, time.Now(), bf.recencyLambda)
+	bf.recencyWeights = append(bf.recencyWeights, weight)
+	bf.recencyTree.appendWeight(weight, bf.recencyWeights)
+
+	return true
+}
+
+// ingestPost adds a freshly observed post - from polling or the Jetstream
+// firehose, as opposed to historical backfill - persisting it and
+// publishing it to any subscribers if it's genuinely new. Persisting here,
+// rather than leaving it to each caller, means Jetstream posts survive a
+// restart instead of living only in memory until the next backfill.
+func (bf *BlueskyFetcher) ingestPost(post PostData) {
+	if !bf.addPost(post) {
+		return
+	}
+	if err := bf.store.Put(bf.did, post); err != nil {
+		log.Printf("persisting post %s: %v", post.Uri, err)
+	}
+	bf.notifier.Publish(post)
+}
+
+// removePost drops a post from the heap and the store by URI, so a
+// firehose delete event keeps getRandomPost from ever handing back a
+// tombstoned post.
+func (bf *BlueskyFetcher) removePost(uri string) {
+	bf.mu.Lock()
+	filtered := make(MaxHeap, 0, bf.posts.Len())
+	for i := 0; i < bf.posts.Len(); i++ {
+		if post := bf.posts.Get(i); post.Uri != uri {
+			filtered = append(filtered, post)
+		}
+	}
+	*bf.posts = filtered
+	bf.rebuildRecencyLocked()
+	bf.mu.Unlock()
+
+	if err := bf.store.Delete(bf.did, uri); err != nil {
+		log.Printf("error deleting post %s from store: %v", uri, err)
+	}
+}
+
+// rebuildRecencyLocked recomputes every RecencyWeighted sampling weight
+// against the current time and rebuilds the Fenwick tree from scratch.
+// Callers must hold bf.mu.
+func (bf *BlueskyFetcher) rebuildRecencyLocked() {
+	now := time.Now()
+	weights := make([]float64, bf.posts.Len())
+	for i := 0; i < bf.posts.Len(); i++ {
+		weights[i] = recencyWeight(bf.posts.Get(i), now, bf.recencyLambda)
+	}
+	bf.recencyWeights = weights
+	bf.recencyTree.rebuild(weights)
+}
+
+// reageRecencyWeights re-scores every post's RecencyWeighted sampling
+// weight against the current time. Called periodically (see
+// SamplerRegistry.StartPeriodicEnqueue) instead of on every request, so
+// aging a post doesn't cost anything at sample time.
+func (bf *BlueskyFetcher) reageRecencyWeights() {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.rebuildRecencyLocked()
+}
+
+// setStreaming records whether the Jetstream ingester currently holds a
+// live connection for this fetcher's DID, so startPeriodicUpdates knows
+// whether polling is acting as the primary source or just a fallback.
+func (bf *BlueskyFetcher) setStreaming(streaming bool) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.streaming = streaming
+}
+
+func (bf *BlueskyFetcher) isStreaming() bool {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	return bf.streaming
+}
+
+// startPeriodicUpdates starts a goroutine that periodically checks for new
+// posts. While the Jetstream ingester is connected, this is just a safety
+// net; polling only does real work once the stream has dropped.
 func (bf *BlueskyFetcher) startPeriodicUpdates(interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 		for {
 			<-ticker.C
+			if bf.isStreaming() {
+				continue
+			}
 			fmt.Println("Checking for new posts")
 			if err := bf.checkForNewPosts(); err != nil {
 				log.Printf("Error checking for new posts: %v", err)
@@ -174,9 +490,11 @@ func (bf *BlueskyFetcher) startPeriodicUpdates(interval time.Duration) {
 	}()
 }
 
-// randomPostHandler returns a random post as JSON over HTTP
+// randomPostHandler returns a random post as JSON over HTTP. By default it
+// samples uniformly; ?strategy=recency (with an optional ?halflife=, e.g.
+// "7d") switches to RecencyWeighted sampling instead.
 func (bf *BlueskyFetcher) randomPostHandler(w http.ResponseWriter, r *http.Request) {
-	randomPost, err := bf.getRandomPost()
+	randomPost, err := bf.selectRandomPost(r.URL.Query())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -189,27 +507,94 @@ func (bf *BlueskyFetcher) randomPostHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-// main function initializes the HTTP server and starts the periodic post update.
+// selectRandomPost picks a post according to the ?strategy= query param
+// ("uniform", the default, or "recency") and, for recency weighting, the
+// ?halflife= duration.
+func (bf *BlueskyFetcher) selectRandomPost(query url.Values) (PostData, error) {
+	switch strategy := query.Get("strategy"); strategy {
+	case "", "uniform":
+		return bf.getRandomPost()
+	case "recency":
+		halfLife := defaultHalfLife
+		if raw := query.Get("halflife"); raw != "" {
+			parsed, err := parseHalfLife(raw)
+			if err != nil {
+				return PostData{}, fmt.Errorf("invalid halflife: %w", err)
+			}
+			halfLife = parsed
+		}
+		return bf.getRandomPostRecencyWeighted(halfLifeToLambda(halfLife))
+	default:
+		return PostData{}, fmt.Errorf("unknown sampling strategy %q", strategy)
+	}
+}
+
+// main function initializes the HTTP server and starts the registry's
+// periodic post refresh.
 func main() {
-	handle := "carl.cx"
-	fmt.Printf("Fetching data for Bluesky handle: %s\n", handle)
+	dbPath := flag.String("db-path", "bsky-sampler.db", "path to the persistent post store")
+	configPath := flag.String("config", "", "path to a YAML or JSON config listing handles to track")
+	handles := flag.String("handles", "carl.cx", "comma-separated list of handles to track (ignored if --config is set)")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "number of concurrent fetch workers")
+	webhookSecret := flag.String("webhook-secret", "", "HMAC-SHA256 secret used to sign webhook deliveries")
+	firebaseKeyFile := flag.String("firebase-key-file", "", "path to a Firebase service account key; enables FCM push notifications")
+	compactInterval := flag.Duration("compact-interval", 24*time.Hour, "how often to compact the post store (0 disables)")
+	flag.Parse()
+
+	cfg := &SamplerConfig{Concurrency: *concurrency}
+	if *configPath != "" {
+		loaded, err := loadSamplerConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+		cfg = loaded
+	} else {
+		cfg.Handles = strings.Split(*handles, ",")
+	}
+	fmt.Printf("Tracking %d Bluesky handle(s) with %d fetch worker(s)\n", len(cfg.Handles), cfg.Concurrency)
 
-	// Create the fetcher
-	fetcher, err := NewBlueskyFetcher(handle)
+	store, err := NewBoltPostStore(*dbPath)
 	if err != nil {
-		log.Fatalf("Error creating Bluesky fetcher: %v", err)
+		log.Fatalf("Error opening post store: %v", err)
 	}
+	defer store.Close()
 
-	// Initialize the recent post list
-	if err := fetcher.updatePosts(); err != nil {
-		log.Fatalf("Error initializing posts: %v", err)
+	// Create the registry: resolves every handle and seeds its heap from
+	// the store. Full-history backfill runs separately, bounded by the
+	// worker pool, so it doesn't delay serving traffic.
+	registry, err := NewSamplerRegistry(cfg, store)
+	if err != nil {
+		log.Fatalf("Error creating sampler registry: %v", err)
+	}
+	registry.StartBackfill()
+	registry.StartPeriodicCompaction(*compactInterval)
+
+	// Set up HTTP handlers
+	http.HandleFunc("/", registry.randomHandler)
+	http.HandleFunc("/random/", registry.handleRoute)
+	http.HandleFunc("/oembed", registry.oembedHandler)
+	http.Handle("/metrics", promhttp.Handler())
+
+	ctx := context.Background()
+
+	// Wire up push subscriptions: webhooks and SSE always, FCM only if a
+	// service account key was given.
+	webhook, sse, err := registry.SetupNotifications(ctx, *webhookSecret, *firebaseKeyFile)
+	if err != nil {
+		log.Fatalf("Error setting up notifications: %v", err)
 	}
+	http.HandleFunc("/webhooks", webhook.SubscribeHandler)
+	http.HandleFunc("/events", sse.EventsHandler)
 
-	// Set up HTTP handler
-	http.HandleFunc("/", fetcher.randomPostHandler)
+	// Start the Jetstream firehose subscription across every tracked
+	// handle; polling keeps running alongside it as a fallback for
+	// whichever handles drop off the stream.
+	ingester := NewJetstreamIngester("", registry.fetchers)
+	go ingester.Run(ctx)
 
-	// Start periodic updates
-	fetcher.startPeriodicUpdates(1 * time.Hour)
+	// Start the bounded fetch worker pool and its periodic refresh schedule.
+	registry.StartWorkers(ctx)
+	registry.StartPeriodicEnqueue(1 * time.Hour)
 
 	log.Fatal(http.ListenAndServe(":80", nil))
 }
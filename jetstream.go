@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultJetstreamEndpoint is the public Jetstream instance we subscribe to
+// for real-time app.bsky.feed.post commit events.
+const defaultJetstreamEndpoint = "wss://jetstream2.us-east.bsky.network/subscribe"
+
+// Reconnect backoff shape: 5s initial delay, doubling up to a 60s ceiling,
+// with +/-50% jitter so a mass disconnect doesn't reconnect in lockstep.
+const (
+	jetstreamInitialBackoff = 5 * time.Second
+	jetstreamMaxBackoff     = 60 * time.Second
+	jetstreamBackoffFactor  = 2.0
+	jetstreamJitter         = 0.5
+)
+
+// jetstreamEvent is the subset of a Jetstream message we care about: a
+// repo commit touching the app.bsky.feed.post collection.
+type jetstreamEvent struct {
+	Did    string `json:"did"`
+	Kind   string `json:"kind"`
+	Commit *struct {
+		Operation  string          `json:"operation"`
+		Collection string          `json:"collection"`
+		RKey       string          `json:"rkey"`
+		Record     json.RawMessage `json:"record"`
+	} `json:"commit"`
+}
+
+// jetstreamPostRecord is the slice of an app.bsky.feed.post record we need
+// to build a PostData.
+type jetstreamPostRecord struct {
+	Text      string `json:"text"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// JetstreamIngester subscribes to a Bluesky Jetstream endpoint and streams
+// app.bsky.feed.post commits for a set of tracked DIDs into the matching
+// BlueskyFetcher's heap, so new posts (and deletes) show up without waiting
+// on the polling ticker.
+type JetstreamIngester struct {
+	endpoint string
+	fetchers map[string]*BlueskyFetcher // did -> fetcher
+}
+
+// NewJetstreamIngester builds an ingester for the given DID-to-fetcher map.
+// An empty endpoint falls back to the public Jetstream instance.
+func NewJetstreamIngester(endpoint string, fetchers map[string]*BlueskyFetcher) *JetstreamIngester {
+	if endpoint == "" {
+		endpoint = defaultJetstreamEndpoint
+	}
+	return &JetstreamIngester{endpoint: endpoint, fetchers: fetchers}
+}
+
+// Run connects to Jetstream and processes events until ctx is cancelled,
+// reconnecting with exponential backoff whenever the connection drops.
+func (j *JetstreamIngester) Run(ctx context.Context) {
+	backoff := jetstreamInitialBackoff
+	for ctx.Err() == nil {
+		if err := j.connectAndRead(ctx); err != nil {
+			log.Printf("jetstream: %v", err)
+		}
+		j.setAllStreaming(false)
+
+		sleep := backoff + time.Duration(rand.Float64()*jetstreamJitter*float64(backoff))
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = time.Duration(float64(backoff) * jetstreamBackoffFactor)
+		if backoff > jetstreamMaxBackoff {
+			backoff = jetstreamMaxBackoff
+		}
+	}
+}
+
+// connectAndRead dials Jetstream, resets the backoff once the connection is
+// live, and reads events until the connection fails.
+func (j *JetstreamIngester) connectAndRead(ctx context.Context) error {
+	dialURL, err := j.dialURL()
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, dialURL, nil)
+	if err != nil {
+		return fmt.Errorf("dialing jetstream: %w", err)
+	}
+	defer conn.Close()
+
+	j.setAllStreaming(true)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("reading jetstream message: %w", err)
+		}
+		j.handleMessage(message)
+	}
+}
+
+// dialURL builds the subscribe URL, scoped to the post collection and the
+// DIDs this ingester is tracking.
+func (j *JetstreamIngester) dialURL() (string, error) {
+	u, err := url.Parse(j.endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing jetstream endpoint: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("wantedCollections", "app.bsky.feed.post")
+	for did := range j.fetchers {
+		q.Add("wantedDids", did)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// handleMessage parses one Jetstream event and applies it to the matching
+// fetcher, ignoring anything that isn't a post create/delete for a tracked DID.
+func (j *JetstreamIngester) handleMessage(raw []byte) {
+	var evt jetstreamEvent
+	if err := json.Unmarshal(raw, &evt); err != nil {
+		log.Printf("jetstream: malformed event: %v", err)
+		return
+	}
+	if evt.Kind != "commit" || evt.Commit == nil || evt.Commit.Collection != "app.bsky.feed.post" {
+		return
+	}
+
+	fetcher, ok := j.fetchers[evt.Did]
+	if !ok {
+		return
+	}
+
+	uri := fmt.Sprintf("at://%s/app.bsky.feed.post/%s", evt.Did, evt.Commit.RKey)
+
+	switch evt.Commit.Operation {
+	case "create":
+		var rec jetstreamPostRecord
+		if err := json.Unmarshal(evt.Commit.Record, &rec); err != nil {
+			log.Printf("jetstream: malformed post record: %v", err)
+			return
+		}
+		fetcher.ingestPost(PostData{
+			Text:      rec.Text,
+			Timestamp: rec.CreatedAt,
+			Uri:       uri,
+		})
+	case "delete":
+		fetcher.removePost(uri)
+	}
+}
+
+// setAllStreaming marks every tracked fetcher as streaming (or not), so
+// startPeriodicUpdates knows whether polling is the primary source.
+func (j *JetstreamIngester) setAllStreaming(streaming bool) {
+	for _, fetcher := range j.fetchers {
+		fetcher.setStreaming(streaming)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newFakeFetcher builds a BlueskyFetcher without resolving a handle over the
+// network, backed by a fresh on-disk store, for tests that only exercise
+// in-memory/ingestion logic.
+func newFakeFetcher(t *testing.T, did, handle string) *BlueskyFetcher {
+	t.Helper()
+	store, err := NewBoltPostStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewBoltPostStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return &BlueskyFetcher{
+		did:    did,
+		handle: handle,
+		posts:  &MaxHeap{},
+		store:  store,
+
+		notifier: nopNotifier{},
+
+		recencyTree:   newFenwickTree(),
+		recencyLambda: defaultRecencyLambda,
+	}
+}
+
+func TestHandleMessageMalformedJSON(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:abc", "carl.cx")
+	j := NewJetstreamIngester("", map[string]*BlueskyFetcher{"did:plc:abc": fetcher})
+
+	// Should log and return without panicking.
+	j.handleMessage([]byte(`not json`))
+
+	if fetcher.Len() != 0 {
+		t.Fatalf("Len() = %d after malformed event, want 0", fetcher.Len())
+	}
+}
+
+func TestHandleMessageIgnoresNonPostCollection(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:abc", "carl.cx")
+	j := NewJetstreamIngester("", map[string]*BlueskyFetcher{"did:plc:abc": fetcher})
+
+	msg := `{"did":"did:plc:abc","kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"1","record":{}}}`
+	j.handleMessage([]byte(msg))
+
+	if fetcher.Len() != 0 {
+		t.Fatalf("Len() = %d after a non-post collection event, want 0", fetcher.Len())
+	}
+}
+
+func TestHandleMessageIgnoresUntrackedDid(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:abc", "carl.cx")
+	j := NewJetstreamIngester("", map[string]*BlueskyFetcher{"did:plc:abc": fetcher})
+
+	msg := `{"did":"did:plc:other","kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"1","record":{"text":"hi","createdAt":"2026-01-01T00:00:00Z"}}}`
+	j.handleMessage([]byte(msg))
+
+	if fetcher.Len() != 0 {
+		t.Fatalf("Len() = %d after an untracked did's event, want 0", fetcher.Len())
+	}
+}
+
+func TestHandleMessageCreatePersistsAndAddsPost(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:abc", "carl.cx")
+	j := NewJetstreamIngester("", map[string]*BlueskyFetcher{"did:plc:abc": fetcher})
+
+	msg := `{"did":"did:plc:abc","kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"1","record":{"text":"hi","createdAt":"2026-01-01T00:00:00Z"}}}`
+	j.handleMessage([]byte(msg))
+
+	if fetcher.Len() != 1 {
+		t.Fatalf("Len() = %d after create event, want 1", fetcher.Len())
+	}
+
+	uri := "at://did:plc:abc/app.bsky.feed.post/1"
+	have, err := fetcher.store.Has(uri)
+	if err != nil {
+		t.Fatalf("Has: %v", err)
+	}
+	if !have {
+		t.Fatal("Has() = false after a create event, want true - Jetstream posts must be persisted")
+	}
+}
+
+func TestHandleMessageDeleteRemovesPost(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:abc", "carl.cx")
+	j := NewJetstreamIngester("", map[string]*BlueskyFetcher{"did:plc:abc": fetcher})
+
+	createMsg := `{"did":"did:plc:abc","kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"1","record":{"text":"hi","createdAt":"2026-01-01T00:00:00Z"}}}`
+	j.handleMessage([]byte(createMsg))
+	if fetcher.Len() != 1 {
+		t.Fatalf("Len() = %d after create event, want 1", fetcher.Len())
+	}
+
+	deleteMsg := `{"did":"did:plc:abc","kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.post","rkey":"1"}}`
+	j.handleMessage([]byte(deleteMsg))
+
+	if fetcher.Len() != 0 {
+		t.Fatalf("Len() = %d after delete event, want 0", fetcher.Len())
+	}
+}
+
+func TestDialURLIncludesWantedCollectionsAndDids(t *testing.T) {
+	j := NewJetstreamIngester("wss://example.com/subscribe", map[string]*BlueskyFetcher{
+		"did:plc:abc": nil,
+	})
+
+	got, err := j.dialURL()
+	if err != nil {
+		t.Fatalf("dialURL: %v", err)
+	}
+	if want := "wss://example.com/subscribe?wantedCollections=app.bsky.feed.post&wantedDids=did%3Aplc%3Aabc"; got != want {
+		t.Errorf("dialURL() = %q, want %q", got, want)
+	}
+}
+
+func TestNewJetstreamIngesterDefaultsEndpoint(t *testing.T) {
+	j := NewJetstreamIngester("", nil)
+	if j.endpoint != defaultJetstreamEndpoint {
+		t.Errorf("endpoint = %q, want default %q", j.endpoint, defaultJetstreamEndpoint)
+	}
+}
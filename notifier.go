@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// Notifier publishes a newly observed post to whatever subscribers it
+// manages. checkForNewPosts (via updatePosts) and the Jetstream ingester
+// call Publish for each post that's genuinely new, not for backfilled history.
+type Notifier interface {
+	Publish(post PostData)
+}
+
+// nopNotifier is the default Notifier for a BlueskyFetcher that hasn't had
+// one wired in, so call sites never need a nil check.
+type nopNotifier struct{}
+
+func (nopNotifier) Publish(PostData) {}
+
+// MultiNotifier fans a single publish out to every configured backend.
+type MultiNotifier struct {
+	notifiers []Notifier
+}
+
+// NewMultiNotifier combines any number of notifiers into one.
+func NewMultiNotifier(notifiers ...Notifier) *MultiNotifier {
+	return &MultiNotifier{notifiers: notifiers}
+}
+
+func (m *MultiNotifier) Publish(post PostData) {
+	for _, n := range m.notifiers {
+		n.Publish(post)
+	}
+}
+
+// Webhook delivery retries with the same backoff shape used elsewhere in
+// this codebase: a handful of attempts, doubling up to a ceiling.
+const (
+	webhookInitialBackoff = 5 * time.Second
+	webhookMaxBackoff     = 60 * time.Second
+	webhookMaxAttempts    = 5
+
+	webhookSignatureHeader = "X-Bsky-Sampler-Signature"
+)
+
+// WebhookNotifier POSTs each new post as JSON to every registered URL,
+// signing the body with HMAC-SHA256 so subscribers can verify it came from
+// us, and retrying with backoff on non-2xx responses.
+type WebhookNotifier struct {
+	secret []byte
+	store  SubscriptionStore
+	client *http.Client
+}
+
+// NewWebhookNotifier builds a notifier that signs deliveries with secret
+// and tracks subscriptions in store.
+func NewWebhookNotifier(secret string, store SubscriptionStore) *WebhookNotifier {
+	return &WebhookNotifier{
+		secret: []byte(secret),
+		store:  store,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Subscribe registers a webhook URL to receive future posts.
+func (w *WebhookNotifier) Subscribe(url string) error {
+	return w.store.AddWebhook(url)
+}
+
+// Unsubscribe removes a previously registered webhook URL.
+func (w *WebhookNotifier) Unsubscribe(url string) error {
+	return w.store.RemoveWebhook(url)
+}
+
+// SubscribeHandler handles POST to register a webhook URL and DELETE to
+// remove one, both via a JSON body of the form {"url": "..."}.
+func (w *WebhookNotifier) SubscribeHandler(rw http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+		http.Error(rw, "expected a JSON body with a non-empty url", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = w.Subscribe(body.URL)
+	case http.MethodDelete:
+		err = w.Unsubscribe(body.URL)
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("error updating subscription: %v", err), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (w *WebhookNotifier) Publish(post PostData) {
+	urls, err := w.store.ListWebhooks()
+	if err != nil {
+		log.Printf("webhook: listing subscriptions: %v", err)
+		return
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(post)
+	if err != nil {
+		log.Printf("webhook: marshaling post: %v", err)
+		return
+	}
+	signature := w.sign(body)
+
+	for _, url := range urls {
+		go w.deliver(url, body, signature)
+	}
+}
+
+func (w *WebhookNotifier) sign(body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver POSTs body to url, retrying on non-2xx responses or transport
+// errors with exponential backoff before giving up.
+func (w *WebhookNotifier) deliver(url string, body []byte, signature string) {
+	backoff := webhookInitialBackoff
+
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if w.attemptDelivery(url, body, signature) {
+			return
+		}
+		if attempt == webhookMaxAttempts {
+			log.Printf("webhook: giving up on %s after %d attempts", url, webhookMaxAttempts)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+func (w *WebhookNotifier) attemptDelivery(url string, body []byte, signature string) bool {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook: building request for %s: %v", url, err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookSignatureHeader, "sha256="+signature)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		log.Printf("webhook: delivering to %s: %v", url, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("webhook: %s responded with status %d", url, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
+// SSENotifier fans new posts out to browser clients connected to /events
+// over Server-Sent Events.
+type SSENotifier struct {
+	mu      sync.Mutex
+	clients map[chan PostData]struct{}
+}
+
+// NewSSENotifier builds an empty SSE notifier.
+func NewSSENotifier() *SSENotifier {
+	return &SSENotifier{clients: make(map[chan PostData]struct{})}
+}
+
+func (s *SSENotifier) Publish(post PostData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- post:
+		default:
+			// Slow client; drop this post rather than block the publisher.
+		}
+	}
+}
+
+// EventsHandler streams every published post to the connecting client as
+// an SSE `data:` event until the request is cancelled.
+func (s *SSENotifier) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := make(chan PostData, 16)
+	s.mu.Lock()
+	s.clients[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, ch)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case post := <-ch:
+			data, err := json.Marshal(post)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// FCMNotifier publishes new posts to a per-handle Firebase Cloud Messaging
+// topic, for native app consumers that don't want to hold a connection open.
+type FCMNotifier struct {
+	client *messaging.Client
+	topic  string
+}
+
+// NewFirebaseApp initializes a Firebase app from a service account key
+// file, shared across every handle's FCMNotifier.
+func NewFirebaseApp(ctx context.Context, keyFile string) (*firebase.App, error) {
+	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("initializing firebase app: %w", err)
+	}
+	return app, nil
+}
+
+// NewFCMNotifier builds a notifier that publishes to the FCM topic for handle.
+func NewFCMNotifier(ctx context.Context, app *firebase.App, handle string) (*FCMNotifier, error) {
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating firebase messaging client: %w", err)
+	}
+	return &FCMNotifier{client: client, topic: fmt.Sprintf("bsky-sampler-%s", handle)}, nil
+}
+
+func (f *FCMNotifier) Publish(post PostData) {
+	data, err := json.Marshal(post)
+	if err != nil {
+		log.Printf("fcm: marshaling post: %v", err)
+		return
+	}
+
+	msg := &messaging.Message{
+		Topic: f.topic,
+		Data:  map[string]string{"post": string(data)},
+	}
+	if _, err := f.client.Send(context.Background(), msg); err != nil {
+		log.Printf("fcm: publishing to topic %s: %v", f.topic, err)
+	}
+}
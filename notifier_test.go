@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookNotifierSignIsHMACSHA256(t *testing.T) {
+	w := NewWebhookNotifier("shared-secret", nil)
+	body := []byte(`{"text":"hello"}`)
+
+	got := w.sign(body)
+
+	mac := hmac.New(sha256.New, []byte("shared-secret"))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if got != want {
+		t.Errorf("sign() = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookNotifierSignIsDeterministic(t *testing.T) {
+	w := NewWebhookNotifier("shared-secret", nil)
+	body := []byte(`{"text":"hello"}`)
+
+	if w.sign(body) != w.sign(body) {
+		t.Error("sign() returned different signatures for the same body")
+	}
+}
+
+func TestWebhookNotifierAttemptDeliverySetsSignatureHeader(t *testing.T) {
+	w := NewWebhookNotifier("shared-secret", nil)
+	body := []byte(`{"text":"hello"}`)
+	signature := w.sign(body)
+
+	var gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(webhookSignatureHeader)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if ok := w.attemptDelivery(server.URL, body, signature); !ok {
+		t.Fatal("attemptDelivery() = false, want true for a 204 response")
+	}
+	if want := "sha256=" + signature; gotSignature != want {
+		t.Errorf("%s header = %q, want %q", webhookSignatureHeader, gotSignature, want)
+	}
+}
+
+func TestWebhookNotifierAttemptDeliveryFailsOnNon2xx(t *testing.T) {
+	w := NewWebhookNotifier("shared-secret", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if ok := w.attemptDelivery(server.URL, []byte("{}"), "sig"); ok {
+		t.Error("attemptDelivery() = true for a 500 response, want false")
+	}
+}
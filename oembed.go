@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// oEmbed defaults per the 1.0 spec's "rich" type; maxwidth/maxheight query
+// params can only ever shrink these, never grow them.
+const (
+	oembedDefaultWidth  = 550
+	oembedMaxWidth      = 550
+	oembedDefaultHeight = 250
+	oembedMaxHeight     = 750
+
+	// noUnauthenticatedLabel is the self-label Bluesky authors attach to
+	// restrict a post from unauthenticated (logged-out) viewing, which an
+	// oEmbed consumer effectively always is.
+	noUnauthenticatedLabel = "!no-unauthenticated"
+)
+
+// oembedResponse is an oEmbed 1.0 "rich" type response.
+type oembedResponse struct {
+	XMLName      xml.Name `json:"-" xml:"oembed"`
+	Type         string   `json:"type" xml:"type"`
+	Version      string   `json:"version" xml:"version"`
+	ProviderName string   `json:"provider_name" xml:"provider_name"`
+	ProviderURL  string   `json:"provider_url" xml:"provider_url"`
+	AuthorName   string   `json:"author_name" xml:"author_name"`
+	AuthorURL    string   `json:"author_url" xml:"author_url"`
+	Html         string   `json:"html" xml:"html"`
+	Width        int      `json:"width" xml:"width"`
+	Height       int      `json:"height" xml:"height"`
+}
+
+// oembedHandler implements the oEmbed 1.0 provider endpoint for any post
+// across the tracked handles (or our own /random URL): given a post URL, it
+// returns an embeddable HTML blockquote matching Bluesky's own embed markup.
+func (reg *SamplerRegistry) oembedHandler(w http.ResponseWriter, r *http.Request) {
+	bf := reg.anyFetcher()
+	if bf == nil {
+		http.Error(w, "no tracked handles available", http.StatusServiceUnavailable)
+		return
+	}
+
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" {
+		http.Error(w, "missing url parameter", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "xml" {
+		http.Error(w, "unsupported format", http.StatusNotImplemented)
+		return
+	}
+
+	atURI, err := reg.resolvePostURI(bf, rawURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not resolve url: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := bsky.FeedGetPosts(bf.ctx, bf.client, []string{atURI})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error fetching post: %v", err), http.StatusBadGateway)
+		return
+	}
+	if len(result.Posts) == 0 {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+	post := result.Posts[0]
+
+	if hasNoUnauthenticatedLabel(post) {
+		http.Error(w, "author has restricted this post from unauthenticated embedding", http.StatusForbidden)
+		return
+	}
+
+	width, height := clampDimensions(r.URL.Query().Get("maxwidth"), r.URL.Query().Get("maxheight"))
+
+	resp := oembedResponse{
+		Type:         "rich",
+		Version:      "1.0",
+		ProviderName: "bsky-sampler",
+		ProviderURL:  "https://bsky.app",
+		AuthorName:   authorDisplayName(post.Author),
+		AuthorURL:    fmt.Sprintf("https://bsky.app/profile/%s", post.Author.Handle),
+		Html:         embedHTML(post, atURI),
+		Width:        width,
+		Height:       height,
+	}
+
+	if format == "xml" {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		if err := xml.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "error encoding XML", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "error encoding JSON", http.StatusInternalServerError)
+	}
+}
+
+// resolvePostURI turns whatever the caller passed as `url` into an
+// at://did/app.bsky.feed.post/rkey URI: a bare at:// URI is used as-is, a
+// bsky.app post link is resolved (handles included, via bf's client), and
+// anything else is treated as a link back to our own random-post endpoint,
+// in which case we sample through reg's handle-weighted /random logic
+// rather than one arbitrary fetcher's heap.
+func (reg *SamplerRegistry) resolvePostURI(bf *BlueskyFetcher, rawURL string) (string, error) {
+	if strings.HasPrefix(rawURL, "at://") {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing url: %w", err)
+	}
+
+	if u.Host == "bsky.app" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 4 || parts[0] != "profile" || parts[2] != "post" {
+			return "", fmt.Errorf("unrecognized bsky.app url shape")
+		}
+		actor, rkey := parts[1], parts[3]
+
+		did := actor
+		if !strings.HasPrefix(actor, "did:") {
+			did, err = getHandleDid(bf.ctx, bf.client, actor)
+			if err != nil {
+				return "", fmt.Errorf("resolving handle in url: %w", err)
+			}
+		}
+		return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, rkey), nil
+	}
+
+	// Assume it's our own /random link and embed whatever /random would
+	// really have served: sampled across every tracked handle, weighted by
+	// post count, not just whichever fetcher happened to handle oEmbed.
+	fetcher := reg.weightedRandomFetcher()
+	if fetcher == nil {
+		return "", fmt.Errorf("no posts available")
+	}
+	post, err := fetcher.getRandomPost()
+	if err != nil {
+		return "", err
+	}
+	return post.Uri, nil
+}
+
+// hasNoUnauthenticatedLabel reports whether the author has self-labelled
+// this post to keep it out of logged-out contexts, which an embed is.
+func hasNoUnauthenticatedLabel(post *bsky.FeedDefs_PostView) bool {
+	if post.Labels == nil {
+		return false
+	}
+	for _, label := range post.Labels {
+		if label != nil && label.Val == noUnauthenticatedLabel {
+			return true
+		}
+	}
+	return false
+}
+
+func authorDisplayName(author *bsky.ActorDefs_ProfileViewBasic) string {
+	if author.DisplayName != nil && *author.DisplayName != "" {
+		return *author.DisplayName
+	}
+	return author.Handle
+}
+
+// embedHTML mirrors the markup Bluesky's own embed.js expects, so the
+// official script can progressively enhance it client-side.
+func embedHTML(post *bsky.FeedDefs_PostView, atURI string) string {
+	feedPost, _ := post.Record.Val.(*bsky.FeedPost)
+	text := ""
+	if feedPost != nil {
+		text = feedPost.Text
+	}
+
+	parts := strings.Split(strings.TrimPrefix(atURI, "at://"), "/")
+	postURL := fmt.Sprintf("https://bsky.app/profile/%s/post/%s", post.Author.Handle, parts[len(parts)-1])
+
+	return fmt.Sprintf(
+		`<blockquote class="bluesky-embed" data-bluesky-uri=%q data-bluesky-cid=%q><p>%s</p>&mdash; %s (<a href=%q>@%s</a>)</blockquote><script async src="https://embed.bsky.app/static/embed.js" charset="utf-8"></script>`,
+		atURI, post.Cid, html.EscapeString(text), html.EscapeString(authorDisplayName(post.Author)), postURL, post.Author.Handle,
+	)
+}
+
+// clampDimensions applies maxwidth/maxheight query params, if present, on
+// top of the default embed size, never exceeding the spec's hard ceiling.
+func clampDimensions(maxwidth, maxheight string) (int, int) {
+	width := oembedDefaultWidth
+	height := oembedDefaultHeight
+
+	if w, err := strconv.Atoi(maxwidth); err == nil && w > 0 && w < width {
+		width = w
+	}
+	if h, err := strconv.Atoi(maxheight); err == nil && h > 0 && h < height {
+		height = h
+	}
+	if width > oembedMaxWidth {
+		width = oembedMaxWidth
+	}
+	if height > oembedMaxHeight {
+		height = oembedMaxHeight
+	}
+	return width, height
+}
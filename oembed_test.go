@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+func TestClampDimensions(t *testing.T) {
+	cases := []struct {
+		name                string
+		maxwidth, maxheight string
+		wantW, wantH        int
+	}{
+		{name: "no params", maxwidth: "", maxheight: "", wantW: oembedDefaultWidth, wantH: oembedDefaultHeight},
+		{name: "smaller than default", maxwidth: "100", maxheight: "50", wantW: 100, wantH: 50},
+		{name: "larger than default is ignored", maxwidth: "9999", maxheight: "9999", wantW: oembedDefaultWidth, wantH: oembedDefaultHeight},
+		{name: "garbage falls back to default", maxwidth: "nope", maxheight: "nope", wantW: oembedDefaultWidth, wantH: oembedDefaultHeight},
+		{name: "negative falls back to default", maxwidth: "-5", maxheight: "-5", wantW: oembedDefaultWidth, wantH: oembedDefaultHeight},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w, h := clampDimensions(c.maxwidth, c.maxheight)
+			if w != c.wantW || h != c.wantH {
+				t.Errorf("clampDimensions(%q, %q) = (%d, %d), want (%d, %d)", c.maxwidth, c.maxheight, w, h, c.wantW, c.wantH)
+			}
+		})
+	}
+}
+
+func TestHasNoUnauthenticatedLabel(t *testing.T) {
+	restrictedVal := noUnauthenticatedLabel
+	otherVal := "porn"
+
+	cases := []struct {
+		name string
+		post *bsky.FeedDefs_PostView
+		want bool
+	}{
+		{name: "no labels", post: &bsky.FeedDefs_PostView{}, want: false},
+		{
+			name: "unrelated label",
+			post: &bsky.FeedDefs_PostView{Labels: []*comatproto.LabelDefs_Label{{Val: otherVal}}},
+			want: false,
+		},
+		{
+			name: "no-unauthenticated label present",
+			post: &bsky.FeedDefs_PostView{Labels: []*comatproto.LabelDefs_Label{{Val: restrictedVal}}},
+			want: true,
+		},
+		{
+			name: "no-unauthenticated label among others",
+			post: &bsky.FeedDefs_PostView{Labels: []*comatproto.LabelDefs_Label{{Val: otherVal}, {Val: restrictedVal}}},
+			want: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := hasNoUnauthenticatedLabel(c.post); got != c.want {
+				t.Errorf("hasNoUnauthenticatedLabel() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAuthorDisplayName(t *testing.T) {
+	displayName := "Carl"
+
+	withName := &bsky.ActorDefs_ProfileViewBasic{Handle: "carl.cx", DisplayName: &displayName}
+	if got := authorDisplayName(withName); got != displayName {
+		t.Errorf("authorDisplayName() = %q, want %q", got, displayName)
+	}
+
+	noName := &bsky.ActorDefs_ProfileViewBasic{Handle: "carl.cx"}
+	if got := authorDisplayName(noName); got != "carl.cx" {
+		t.Errorf("authorDisplayName() = %q, want handle fallback %q", got, "carl.cx")
+	}
+
+	empty := ""
+	emptyName := &bsky.ActorDefs_ProfileViewBasic{Handle: "carl.cx", DisplayName: &empty}
+	if got := authorDisplayName(emptyName); got != "carl.cx" {
+		t.Errorf("authorDisplayName() = %q, want handle fallback for empty display name %q", got, "carl.cx")
+	}
+}
+
+func TestResolvePostURIAtURIPassthrough(t *testing.T) {
+	reg := &SamplerRegistry{}
+	uri := "at://did:plc:abc/app.bsky.feed.post/1"
+
+	got, err := reg.resolvePostURI(nil, uri)
+	if err != nil {
+		t.Fatalf("resolvePostURI(%q): unexpected error: %v", uri, err)
+	}
+	if got != uri {
+		t.Errorf("resolvePostURI(%q) = %q, want unchanged", uri, got)
+	}
+}
+
+func TestResolvePostURIDidActorPassthrough(t *testing.T) {
+	reg := &SamplerRegistry{}
+
+	got, err := reg.resolvePostURI(nil, "https://bsky.app/profile/did:plc:abc/post/xyz")
+	if err != nil {
+		t.Fatalf("resolvePostURI: unexpected error: %v", err)
+	}
+	want := "at://did:plc:abc/app.bsky.feed.post/xyz"
+	if got != want {
+		t.Errorf("resolvePostURI() = %q, want %q", got, want)
+	}
+}
+
+func TestResolvePostURIMalformedBskyAppShapes(t *testing.T) {
+	reg := &SamplerRegistry{}
+
+	cases := []string{
+		"https://bsky.app/profile/carl.cx",
+		"https://bsky.app/profile/carl.cx/feed/xyz",
+		"https://bsky.app/notprofile/carl.cx/post/xyz",
+		"https://bsky.app/",
+	}
+	for _, rawURL := range cases {
+		if _, err := reg.resolvePostURI(nil, rawURL); err == nil {
+			t.Errorf("resolvePostURI(%q) expected an error for an unrecognized bsky.app shape, got nil", rawURL)
+		}
+	}
+}
+
+func TestResolvePostURIOwnRandomFallbackWithNoPosts(t *testing.T) {
+	reg := &SamplerRegistry{fetchers: map[string]*BlueskyFetcher{}}
+
+	if _, err := reg.resolvePostURI(nil, "https://example.com/random"); err == nil {
+		t.Error("resolvePostURI() expected an error when no posts are available, got nil")
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConcurrency bounds how many fetch workers run at once when a
+// config doesn't set one explicitly, so tracking hundreds of handles
+// doesn't mean hammering the PDS with hundreds of simultaneous goroutines.
+const defaultConcurrency = 8
+
+// SamplerConfig is the on-disk shape accepted by --config, in either YAML
+// or JSON (picked by file extension).
+type SamplerConfig struct {
+	Handles     []string `json:"handles" yaml:"handles"`
+	Concurrency int      `json:"concurrency" yaml:"concurrency"`
+}
+
+// loadSamplerConfig reads a SamplerConfig from a YAML or JSON file.
+func loadSamplerConfig(path string) (*SamplerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	cfg := &SamplerConfig{Concurrency: defaultConcurrency}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	return cfg, nil
+}
+
+// registryMetrics are the Prometheus series exported per tracked handle.
+type registryMetrics struct {
+	fetchLatency *prometheus.HistogramVec
+	fetchErrors  *prometheus.CounterVec
+	heapSize     *prometheus.GaugeVec
+}
+
+func newRegistryMetrics() *registryMetrics {
+	return &registryMetrics{
+		fetchLatency: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "bsky_sampler_fetch_latency_seconds",
+			Help: "Latency of author-feed refresh fetches, per handle.",
+		}, []string{"handle"}),
+		fetchErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "bsky_sampler_fetch_errors_total",
+			Help: "Number of failed author-feed refresh fetches, per handle.",
+		}, []string{"handle"}),
+		heapSize: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bsky_sampler_heap_size",
+			Help: "Number of posts currently held in memory, per handle.",
+		}, []string{"handle"}),
+	}
+}
+
+// SamplerRegistry manages one BlueskyFetcher per tracked handle and a
+// bounded worker pool that refreshes them, instead of main hard-coding a
+// single handle and fetcher.
+type SamplerRegistry struct {
+	store PostStore
+
+	fetchers map[string]*BlueskyFetcher // did -> fetcher
+	byHandle map[string]*BlueskyFetcher // handle -> fetcher
+
+	concurrency  int
+	refreshQueue chan string // dids due for refresh
+
+	metrics *registryMetrics
+}
+
+// NewSamplerRegistry resolves every configured handle and seeds its
+// in-memory heap from whatever the store already has, so the registry is
+// ready to serve whatever history is already persisted as soon as it's
+// constructed. Full-history backfill is comparatively slow and runs
+// separately via StartBackfill, so tracking many handles doesn't block
+// the server from binding and serving traffic.
+func NewSamplerRegistry(cfg *SamplerConfig, store PostStore) (*SamplerRegistry, error) {
+	reg := &SamplerRegistry{
+		store:        store,
+		fetchers:     make(map[string]*BlueskyFetcher, len(cfg.Handles)),
+		byHandle:     make(map[string]*BlueskyFetcher, len(cfg.Handles)),
+		concurrency:  cfg.Concurrency,
+		refreshQueue: make(chan string, len(cfg.Handles)),
+		metrics:      newRegistryMetrics(),
+	}
+
+	for _, handle := range cfg.Handles {
+		fetcher, err := NewBlueskyFetcher(handle, store)
+		if err != nil {
+			return nil, fmt.Errorf("creating fetcher for %s: %w", handle, err)
+		}
+		if err := fetcher.loadFromStore(); err != nil {
+			return nil, fmt.Errorf("loading %s from store: %w", handle, err)
+		}
+
+		reg.fetchers[fetcher.did] = fetcher
+		reg.byHandle[handle] = fetcher
+	}
+
+	return reg, nil
+}
+
+// StartBackfill kicks off every tracked fetcher's full-history backfill,
+// bounded to reg.concurrency at a time through the same kind of semaphore
+// StartWorkers uses for refreshes, so 500 tracked handles still means at
+// most reg.concurrency simultaneous backfill walks rather than 500
+// sequential ones blocking server startup.
+func (reg *SamplerRegistry) StartBackfill() {
+	go func() {
+		sem := make(chan struct{}, reg.concurrency)
+		for _, fetcher := range reg.fetchers {
+			fetcher := fetcher
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem }()
+				if err := fetcher.backfillHistory(); err != nil {
+					log.Printf("backfilling %s: %v", fetcher.handle, err)
+				}
+			}()
+		}
+	}()
+}
+
+// StartWorkers launches the bounded pool of goroutines that drain the
+// refresh queue, so N tracked handles never spawn N concurrent fetches.
+func (reg *SamplerRegistry) StartWorkers(ctx context.Context) {
+	for i := 0; i < reg.concurrency; i++ {
+		go reg.worker(ctx)
+	}
+}
+
+func (reg *SamplerRegistry) worker(ctx context.Context) {
+	for {
+		select {
+		case did := <-reg.refreshQueue:
+			reg.refresh(did)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh checks one fetcher for new posts and records its fetch metrics.
+func (reg *SamplerRegistry) refresh(did string) {
+	fetcher, ok := reg.fetchers[did]
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	err := fetcher.checkForNewPosts()
+	reg.metrics.fetchLatency.WithLabelValues(fetcher.handle).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reg.metrics.fetchErrors.WithLabelValues(fetcher.handle).Inc()
+		log.Printf("error refreshing %s: %v", fetcher.handle, err)
+	}
+}
+
+// StartPeriodicEnqueue feeds every non-streaming handle's did into the
+// refresh queue on a fixed interval, replacing each fetcher's own polling
+// ticker with one shared schedule across the whole registry. Heap size is
+// recorded for every handle on every tick, streaming or not - fetchLatency
+// and fetchErrors only make sense when a refresh actually ran, but a
+// streaming handle's heap keeps changing via Jetstream alone and would
+// otherwise sit frozen since refresh() never runs for it.
+func (reg *SamplerRegistry) StartPeriodicEnqueue(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for did, fetcher := range reg.fetchers {
+				fetcher.reageRecencyWeights()
+				reg.metrics.heapSize.WithLabelValues(fetcher.handle).Set(float64(fetcher.Len()))
+
+				if fetcher.isStreaming() {
+					continue
+				}
+				select {
+				case reg.refreshQueue <- did:
+				default:
+					log.Printf("refresh queue full, skipping %s this tick", fetcher.handle)
+				}
+			}
+		}
+	}()
+}
+
+// StartPeriodicCompaction runs the store's Compact pass on a fixed
+// interval, so the on-disk file actually reclaims space freed by deletes
+// and superseded pages instead of only ever growing. A non-positive
+// interval disables it.
+func (reg *SamplerRegistry) StartPeriodicCompaction(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := reg.store.Compact(); err != nil {
+				log.Printf("store compaction failed: %v", err)
+			}
+		}
+	}()
+}
+
+// SetupNotifications wires a webhook notifier and an SSE notifier (plus,
+// if firebaseKeyFile is set, a per-handle FCM notifier) into every tracked
+// fetcher, returning the webhook and SSE notifiers so main can mount their
+// HTTP routes.
+func (reg *SamplerRegistry) SetupNotifications(ctx context.Context, webhookSecret, firebaseKeyFile string) (*WebhookNotifier, *SSENotifier, error) {
+	webhook := NewWebhookNotifier(webhookSecret, reg.store.(SubscriptionStore))
+	sse := NewSSENotifier()
+
+	var firebaseApp *firebase.App
+	if firebaseKeyFile != "" {
+		app, err := NewFirebaseApp(ctx, firebaseKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		firebaseApp = app
+	}
+
+	for _, fetcher := range reg.fetchers {
+		notifiers := []Notifier{webhook, sse}
+		if firebaseApp != nil {
+			fcm, err := NewFCMNotifier(ctx, firebaseApp, fetcher.handle)
+			if err != nil {
+				return nil, nil, fmt.Errorf("creating FCM notifier for %s: %w", fetcher.handle, err)
+			}
+			notifiers = append(notifiers, fcm)
+		}
+		fetcher.SetNotifier(NewMultiNotifier(notifiers...))
+	}
+
+	return webhook, sse, nil
+}
+
+// anyFetcher returns an arbitrary tracked fetcher, useful for endpoints
+// like oEmbed resolution that only need a client talking to the public
+// API rather than a specific handle.
+func (reg *SamplerRegistry) anyFetcher() *BlueskyFetcher {
+	for _, fetcher := range reg.fetchers {
+		return fetcher
+	}
+	return nil
+}
+
+// handleRoute dispatches /random/{handle} to the matching fetcher.
+func (reg *SamplerRegistry) handleRoute(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimPrefix(r.URL.Path, "/random/")
+	fetcher, ok := reg.byHandle[handle]
+	if !ok {
+		http.Error(w, "unknown handle", http.StatusNotFound)
+		return
+	}
+	fetcher.randomPostHandler(w, r)
+}
+
+// randomHandler samples a post from across every tracked handle, weighted
+// by each handle's post count so the pooled sample behaves like one big
+// heap rather than favoring whichever handle happens to have fewer posts.
+func (reg *SamplerRegistry) randomHandler(w http.ResponseWriter, r *http.Request) {
+	fetcher := reg.weightedRandomFetcher()
+	if fetcher == nil {
+		http.Error(w, "no posts available", http.StatusNotFound)
+		return
+	}
+	fetcher.randomPostHandler(w, r)
+}
+
+func (reg *SamplerRegistry) weightedRandomFetcher() *BlueskyFetcher {
+	total := 0
+	for _, fetcher := range reg.fetchers {
+		total += fetcher.Len()
+	}
+	if total == 0 {
+		return nil
+	}
+
+	target := rand.Intn(total)
+	for _, fetcher := range reg.fetchers {
+		n := fetcher.Len()
+		if target < n {
+			return fetcher
+		}
+		target -= n
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newUnregisteredMetrics builds registryMetrics without promauto, so
+// repeated calls across tests don't collide on the default registerer.
+func newUnregisteredMetrics() *registryMetrics {
+	return &registryMetrics{
+		fetchLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_fetch_latency"}, []string{"handle"}),
+		fetchErrors:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_fetch_errors"}, []string{"handle"}),
+		heapSize:     prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_heap_size"}, []string{"handle"}),
+	}
+}
+
+func newTestRegistry(t *testing.T, concurrency int, fetchers ...*BlueskyFetcher) *SamplerRegistry {
+	t.Helper()
+	reg := &SamplerRegistry{
+		fetchers:     make(map[string]*BlueskyFetcher, len(fetchers)),
+		byHandle:     make(map[string]*BlueskyFetcher, len(fetchers)),
+		concurrency:  concurrency,
+		refreshQueue: make(chan string, len(fetchers)),
+		metrics:      newUnregisteredMetrics(),
+	}
+	for _, fetcher := range fetchers {
+		reg.fetchers[fetcher.did] = fetcher
+		reg.byHandle[fetcher.handle] = fetcher
+	}
+	return reg
+}
+
+func TestWeightedRandomFetcherNoPosts(t *testing.T) {
+	reg := newTestRegistry(t, 1, newFakeFetcher(t, "did:plc:a", "a.cx"))
+	if got := reg.weightedRandomFetcher(); got != nil {
+		t.Errorf("weightedRandomFetcher() = %v, want nil when no fetcher has posts", got)
+	}
+}
+
+func TestWeightedRandomFetcherSingleFetcher(t *testing.T) {
+	fetcher := newFakeFetcher(t, "did:plc:a", "a.cx")
+	fetcher.addPost(PostData{Uri: "at://did:plc:a/app.bsky.feed.post/1", Timestamp: "2026-01-01T00:00:00Z"})
+
+	reg := newTestRegistry(t, 1, fetcher)
+	if got := reg.weightedRandomFetcher(); got != fetcher {
+		t.Errorf("weightedRandomFetcher() = %v, want the only fetcher with posts", got)
+	}
+}
+
+func TestWeightedRandomFetcherOnlyPicksFromNonEmptyFetchers(t *testing.T) {
+	empty := newFakeFetcher(t, "did:plc:empty", "empty.cx")
+	full := newFakeFetcher(t, "did:plc:full", "full.cx")
+	for i := 0; i < 5; i++ {
+		full.addPost(PostData{Uri: "at://did:plc:full/app.bsky.feed.post/" + string(rune('a'+i)), Timestamp: "2026-01-01T00:00:00Z"})
+	}
+
+	reg := newTestRegistry(t, 1, empty, full)
+	for i := 0; i < 50; i++ {
+		if got := reg.weightedRandomFetcher(); got != full {
+			t.Fatalf("weightedRandomFetcher() = %v, want the only non-empty fetcher", got)
+		}
+	}
+}
+
+func TestStartBackfillBoundsConcurrency(t *testing.T) {
+	const concurrency = 2
+	const numFetchers = 8
+
+	var current, max int64
+	fetchers := make([]*BlueskyFetcher, 0, numFetchers)
+	for i := 0; i < numFetchers; i++ {
+		did := "did:plc:" + string(rune('a'+i))
+		fetcher := newFakeFetcher(t, did, did)
+		// Mark backfill already complete so backfillHistory returns without
+		// making a network call, while still exercising StartBackfill's
+		// semaphore-bounded fan-out around it.
+		if err := fetcher.store.SetBackfillProgress(did, BackfillProgress{Complete: true}); err != nil {
+			t.Fatalf("SetBackfillProgress: %v", err)
+		}
+		fetchers = append(fetchers, fetcher)
+	}
+
+	reg := newTestRegistry(t, concurrency, fetchers...)
+
+	var wg sync.WaitGroup
+	wg.Add(numFetchers)
+
+	// Swap each fetcher's store for one that tracks concurrent BackfillProgress
+	// calls, so the semaphore bound is observable without touching the network.
+	for _, fetcher := range fetchers {
+		fetcher.store = &concurrencyTrackingStore{
+			PostStore: fetcher.store,
+			current:   &current,
+			max:       &max,
+			done:      &wg,
+		}
+	}
+
+	reg.StartBackfill()
+
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for all backfills to finish")
+	}
+
+	if got := atomic.LoadInt64(&max); got == 0 {
+		t.Fatal("no backfill ran concurrently at all")
+	} else if got > concurrency {
+		t.Errorf("max concurrent backfills = %d, want <= %d", got, concurrency)
+	}
+}
+
+// concurrencyTrackingStore wraps a PostStore to count how many goroutines
+// are inside BackfillProgress at once, standing in for the backfill work
+// itself so the test can observe StartBackfill's concurrency bound. done is
+// marked after each call so the test can wait for every fetcher's backfill
+// to actually finish before letting t.Cleanup close the underlying stores.
+type concurrencyTrackingStore struct {
+	PostStore
+	current *int64
+	max     *int64
+	done    *sync.WaitGroup
+}
+
+func (s *concurrencyTrackingStore) BackfillProgress(did string) (BackfillProgress, error) {
+	defer s.done.Done()
+
+	n := atomic.AddInt64(s.current, 1)
+	for {
+		old := atomic.LoadInt64(s.max)
+		if n <= old || atomic.CompareAndSwapInt64(s.max, old, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	defer atomic.AddInt64(s.current, -1)
+	return s.PostStore.BackfillProgress(did)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHalfLife and defaultRecencyLambda give RecencyWeighted sampling a
+// 30-day half-life unless a request overrides it via ?halflife=.
+const defaultRecencyLambda = math.Ln2 / 30
+
+var defaultHalfLife = 30 * 24 * time.Hour
+
+// recencyWeight is exp(-lambda * ageDays), the RecencyWeighted strategy's
+// sampling weight for a single post. Posts whose timestamp we can't parse
+// fall back to a weight of 1, same as a very recent post, rather than
+// dropping out of the sample entirely.
+func recencyWeight(post PostData, now time.Time, lambda float64) float64 {
+	createdAt, err := time.Parse(time.RFC3339, post.Timestamp)
+	if err != nil {
+		return 1
+	}
+	ageDays := now.Sub(createdAt).Hours() / 24
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	return math.Exp(-lambda * ageDays)
+}
+
+// halfLifeToLambda converts a half-life duration into the lambda used by
+// recencyWeight, falling back to the default half-life for a non-positive
+// or zero duration.
+func halfLifeToLambda(halfLife time.Duration) float64 {
+	days := halfLife.Hours() / 24
+	if days <= 0 {
+		return defaultRecencyLambda
+	}
+	return math.Ln2 / days
+}
+
+// parseHalfLife parses a half-life like "30d" or a plain Go duration like
+// "720h"; time.ParseDuration doesn't understand a bare "d" unit, so that
+// shorthand is handled separately.
+func parseHalfLife(raw string) (time.Duration, error) {
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(raw, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing day count: %w", err)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// fenwickTree is a Fenwick tree (binary indexed tree) over a set of
+// non-negative weights, giving O(log n) prefix sums and point updates.
+// Capacity doubles like a dynamic array, so appending a weight is
+// amortized O(log n) rather than a full rebuild on every insert.
+type fenwickTree struct {
+	tree     []float64 // 1-indexed; len(tree) == capacity+1
+	n        int       // number of live weights
+	capacity int       // power-of-two capacity >= n
+}
+
+func newFenwickTree() *fenwickTree {
+	return &fenwickTree{tree: make([]float64, 2), capacity: 1}
+}
+
+// add applies delta to the weight at 0-indexed position i.
+func (f *fenwickTree) add(i int, delta float64) {
+	for i++; i <= f.capacity; i += i & (-i) {
+		f.tree[i] += delta
+	}
+}
+
+// prefixSum returns the sum of weights at positions [0, i].
+func (f *fenwickTree) prefixSum(i int) float64 {
+	var sum float64
+	for i++; i > 0; i -= i & (-i) {
+		sum += f.tree[i]
+	}
+	return sum
+}
+
+// total returns the sum of every live weight.
+func (f *fenwickTree) total() float64 {
+	if f.n == 0 {
+		return 0
+	}
+	return f.prefixSum(f.n - 1)
+}
+
+// findByWeight returns the smallest 0-indexed position i such that
+// prefixSum(i) > target: the index a draw of `target` in [0, total()) lands on.
+func (f *fenwickTree) findByWeight(target float64) int {
+	pos, logCap := 0, 0
+	for (1 << uint(logCap+1)) <= f.capacity {
+		logCap++
+	}
+	for pw := logCap; pw >= 0; pw-- {
+		next := pos + (1 << uint(pw))
+		if next <= f.capacity && f.tree[next] <= target {
+			pos = next
+			target -= f.tree[next]
+		}
+	}
+	if pos >= f.n {
+		pos = f.n - 1
+	}
+	return pos
+}
+
+// appendWeight adds one new weight at the end. allWeights must already
+// include it (i.e. have length n+1) so a capacity doubling, if needed, can
+// rebuild from the full set.
+func (f *fenwickTree) appendWeight(weight float64, allWeights []float64) {
+	if f.n == f.capacity {
+		f.rebuild(allWeights)
+		return
+	}
+	f.n++
+	f.add(f.n-1, weight)
+}
+
+// rebuild grows capacity to the next power of two fitting allWeights and
+// reconstructs the tree from scratch - used both for capacity growth and
+// for a full re-score (e.g. the hourly recency re-aging pass).
+func (f *fenwickTree) rebuild(allWeights []float64) {
+	capacity := 1
+	for capacity < len(allWeights) {
+		capacity *= 2
+	}
+	f.capacity = capacity
+	f.n = len(allWeights)
+	f.tree = make([]float64, capacity+1)
+	for i, w := range allWeights {
+		f.add(i, w)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFenwickTreeEmpty(t *testing.T) {
+	f := newFenwickTree()
+	if total := f.total(); total != 0 {
+		t.Fatalf("total() on empty tree = %v, want 0", total)
+	}
+}
+
+func TestFenwickTreeSingleElement(t *testing.T) {
+	f := newFenwickTree()
+	f.appendWeight(5, []float64{5})
+
+	if total := f.total(); total != 5 {
+		t.Fatalf("total() = %v, want 5", total)
+	}
+	if idx := f.findByWeight(0); idx != 0 {
+		t.Fatalf("findByWeight(0) = %d, want 0", idx)
+	}
+	if idx := f.findByWeight(4.999); idx != 0 {
+		t.Fatalf("findByWeight(4.999) = %d, want 0", idx)
+	}
+}
+
+func TestFenwickTreeCapacityDoubling(t *testing.T) {
+	f := newFenwickTree()
+	var weights []float64
+
+	// Capacity starts at 1, so every append after the first should exercise
+	// the rebuild path at least once.
+	for i := 0; i < 10; i++ {
+		weights = append(weights, float64(i+1))
+		f.appendWeight(float64(i+1), weights)
+	}
+
+	var want float64
+	for _, w := range weights {
+		want += w
+	}
+	if total := f.total(); total != want {
+		t.Fatalf("total() = %v, want %v", total, want)
+	}
+
+	var cumulative float64
+	for i, w := range weights {
+		cumulative += w
+		if sum := f.prefixSum(i); sum != cumulative {
+			t.Fatalf("prefixSum(%d) = %v, want %v", i, sum, cumulative)
+		}
+	}
+}
+
+func TestFenwickTreeFindByWeight(t *testing.T) {
+	f := newFenwickTree()
+	weights := []float64{1, 2, 3, 4}
+	for i, w := range weights {
+		f.appendWeight(w, weights[:i+1])
+	}
+
+	// Cumulative sums are 1, 3, 6, 10. findByWeight(target) returns the
+	// smallest index whose prefix sum exceeds target.
+	cases := map[float64]int{
+		0:   0,
+		0.5: 0,
+		1:   1,
+		2.9: 1,
+		3:   2,
+		5.9: 2,
+		6:   3,
+		9.9: 3,
+	}
+	for target, want := range cases {
+		if got := f.findByWeight(target); got != want {
+			t.Errorf("findByWeight(%v) = %d, want %d", target, got, want)
+		}
+	}
+}
+
+func TestRecencyWeightDecaysWithAge(t *testing.T) {
+	now := time.Now()
+	lambda := math.Ln2 / 30 // 30-day half-life
+
+	fresh := PostData{Timestamp: now.Format(time.RFC3339)}
+	old := PostData{Timestamp: now.Add(-30 * 24 * time.Hour).Format(time.RFC3339)}
+
+	freshWeight := recencyWeight(fresh, now, lambda)
+	oldWeight := recencyWeight(old, now, lambda)
+
+	if math.Abs(freshWeight-1) > 1e-6 {
+		t.Errorf("weight of a brand-new post = %v, want ~1", freshWeight)
+	}
+	if math.Abs(oldWeight-0.5) > 1e-6 {
+		t.Errorf("weight of a post one half-life old = %v, want ~0.5", oldWeight)
+	}
+}
+
+func TestRecencyWeightUnparseableTimestampFallsBackToOne(t *testing.T) {
+	post := PostData{Timestamp: "not-a-timestamp"}
+	if w := recencyWeight(post, time.Now(), defaultRecencyLambda); w != 1 {
+		t.Errorf("weight of a post with an unparseable timestamp = %v, want 1", w)
+	}
+}
+
+func TestHalfLifeToLambda(t *testing.T) {
+	if got := halfLifeToLambda(0); got != defaultRecencyLambda {
+		t.Errorf("halfLifeToLambda(0) = %v, want default %v", got, defaultRecencyLambda)
+	}
+
+	got := halfLifeToLambda(30 * 24 * time.Hour)
+	if math.Abs(got-defaultRecencyLambda) > 1e-9 {
+		t.Errorf("halfLifeToLambda(30d) = %v, want %v", got, defaultRecencyLambda)
+	}
+}
+
+func TestParseHalfLife(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{raw: "30d", want: 30 * 24 * time.Hour},
+		{raw: "7d", want: 7 * 24 * time.Hour},
+		{raw: "720h", want: 720 * time.Hour},
+		{raw: "not-a-duration", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseHalfLife(c.raw)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseHalfLife(%q) expected an error, got %v", c.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHalfLife(%q) unexpected error: %v", c.raw, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseHalfLife(%q) = %v, want %v", c.raw, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket layout:
+//
+//	posts      uri                        -> PostData JSON
+//	by_did     did\x00uri                 -> uri   (secondary index on did)
+//	by_created did\x00createdAt\x00uri    -> uri   (secondary index on createdAt)
+//	backfill   did                        -> BackfillProgress JSON
+var (
+	postsBucket     = []byte("posts")
+	byDidBucket     = []byte("by_did")
+	byCreatedBucket = []byte("by_created")
+
+	// webhookSubscriptionsBucket holds registered webhook URLs, keyed by
+	// the URL itself, so subscriptions survive a restart.
+	webhookSubscriptionsBucket = []byte("webhook_subscriptions")
+
+	// backfillBucket holds each did's backfill progress, so an interrupted
+	// backfill resumes from where it left off instead of restarting from
+	// page 1.
+	backfillBucket = []byte("backfill")
+)
+
+// BackfillProgress records how far a did's full-history backfill walk has
+// reached: the furthest author-feed cursor fetched, and whether the walk
+// has reached the account's earliest post (or a post already in the store,
+// meaning everything before it is already backfilled).
+type BackfillProgress struct {
+	Cursor   string `json:"cursor"`
+	Complete bool   `json:"complete"`
+}
+
+// SubscriptionStore persists webhook subscription URLs across restarts.
+type SubscriptionStore interface {
+	AddWebhook(url string) error
+	RemoveWebhook(url string) error
+	ListWebhooks() ([]string, error)
+}
+
+// PostStore persists PostData across restarts, keyed by URI with secondary
+// indexes on did and createdAt, so BlueskyFetcher can sample from an
+// account's full history rather than whatever fits in memory.
+type PostStore interface {
+	// Put upserts a post, recording it under the given did.
+	Put(did string, post PostData) error
+	// Has reports whether a post with this URI is already stored.
+	Has(uri string) (bool, error)
+	// Delete removes a post by URI.
+	Delete(did, uri string) error
+	// ByDid returns every post stored for a did, oldest first.
+	ByDid(did string) ([]PostData, error)
+	// BackfillProgress returns the last persisted backfill progress for a
+	// did (the zero value if none has been recorded yet).
+	BackfillProgress(did string) (BackfillProgress, error)
+	// SetBackfillProgress persists how far a did's backfill walk has reached.
+	SetBackfillProgress(did string, progress BackfillProgress) error
+	// Compact reclaims space freed by deletes and old page versions.
+	Compact() error
+	// Close releases the underlying database file.
+	Close() error
+}
+
+// BoltPostStore is a PostStore backed by a BoltDB (bbolt) file. mu guards
+// the db field itself (as opposed to bbolt's own internal locking, which
+// guards the data): Compact closes and replaces db, so every other method
+// holds a read lock for the duration of its call to keep that swap from
+// racing with (and closing out from under) an in-flight transaction.
+type BoltPostStore struct {
+	mu   sync.RWMutex
+	db   *bolt.DB
+	path string
+}
+
+// NewBoltPostStore opens (creating if necessary) a BoltDB file at path and
+// ensures the buckets used by PostStore exist.
+func NewBoltPostStore(path string) (*BoltPostStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening post store at %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{postsBucket, byDidBucket, byCreatedBucket, webhookSubscriptionsBucket, backfillBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing post store buckets: %w", err)
+	}
+
+	return &BoltPostStore{db: db, path: path}, nil
+}
+
+func didKey(did, uri string) []byte {
+	return []byte(did + "\x00" + uri)
+}
+
+func createdKey(did, createdAt, uri string) []byte {
+	return []byte(did + "\x00" + createdAt + "\x00" + uri)
+}
+
+// Put upserts a post and its secondary index entries in a single transaction.
+func (s *BoltPostStore) Put(did string, post PostData) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return fmt.Errorf("marshaling post: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(postsBucket).Put([]byte(post.Uri), data); err != nil {
+			return err
+		}
+		if err := tx.Bucket(byDidBucket).Put(didKey(did, post.Uri), []byte(post.Uri)); err != nil {
+			return err
+		}
+		return tx.Bucket(byCreatedBucket).Put(createdKey(did, post.Timestamp, post.Uri), []byte(post.Uri))
+	})
+}
+
+// Has reports whether a post with this URI is already in the store.
+func (s *BoltPostStore) Has(uri string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(postsBucket).Get([]byte(uri)) != nil
+		return nil
+	})
+	return found, err
+}
+
+// Delete removes a post and its secondary index entries.
+func (s *BoltPostStore) Delete(did, uri string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(postsBucket).Delete([]byte(uri)); err != nil {
+			return err
+		}
+		return tx.Bucket(byDidBucket).Delete(didKey(did, uri))
+		// The by_created entry is left to a future Compact pass; createdAt
+		// isn't known here without a round trip, and a dangling index entry
+		// just means ByDid skips a uri that's no longer in postsBucket.
+	})
+}
+
+// ByDid returns every post stored for a did, oldest first.
+func (s *BoltPostStore) ByDid(did string) ([]PostData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []PostData
+	prefix := []byte(did + "\x00")
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		postsB := tx.Bucket(postsBucket)
+		c := tx.Bucket(byCreatedBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			data := postsB.Get(v)
+			if data == nil {
+				continue // stale index entry for a deleted post
+			}
+			var post PostData
+			if err := json.Unmarshal(data, &post); err != nil {
+				return fmt.Errorf("unmarshaling post: %w", err)
+			}
+			posts = append(posts, post)
+		}
+		return nil
+	})
+	return posts, err
+}
+
+// BackfillProgress returns the last persisted backfill progress for a did,
+// or the zero value if none has been recorded yet.
+func (s *BoltPostStore) BackfillProgress(did string) (BackfillProgress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var progress BackfillProgress
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(backfillBucket).Get([]byte(did))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &progress)
+	})
+	return progress, err
+}
+
+// SetBackfillProgress persists how far a did's backfill walk has reached.
+func (s *BoltPostStore) SetBackfillProgress(did string, progress BackfillProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("marshaling backfill progress: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillBucket).Put([]byte(did), data)
+	})
+}
+
+// Compact rewrites the database file into a fresh one to reclaim space
+// freed by deletes and superseded pages - the BoltDB equivalent of a vacuum.
+// Held exclusively for the whole operation, so it waits for in-flight
+// reads/writes to finish and blocks new ones until the swap completes.
+func (s *BoltPostStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpPath := s.path + ".compact"
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(tmpPath, 0600)
+	}); err != nil {
+		return fmt.Errorf("copying database for compaction: %w", err)
+	}
+
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("closing database before compaction swap: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("swapping compacted database into place: %w", err)
+	}
+
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("reopening compacted database: %w", err)
+	}
+	s.db = db
+	return nil
+}
+
+// Close releases the underlying database file.
+func (s *BoltPostStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
+
+// AddWebhook registers a webhook URL so it survives a restart.
+func (s *BoltPostStore) AddWebhook(url string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookSubscriptionsBucket).Put([]byte(url), []byte{1})
+	})
+}
+
+// RemoveWebhook unregisters a webhook URL.
+func (s *BoltPostStore) RemoveWebhook(url string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookSubscriptionsBucket).Delete([]byte(url))
+	})
+}
+
+// ListWebhooks returns every currently registered webhook URL.
+func (s *BoltPostStore) ListWebhooks() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var urls []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookSubscriptionsBucket).ForEach(func(k, _ []byte) error {
+			urls = append(urls, string(k))
+			return nil
+		})
+	})
+	return urls, err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *BoltPostStore {
+	t.Helper()
+	store, err := NewBoltPostStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewBoltPostStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBoltPostStorePutHasDelete(t *testing.T) {
+	store := newTestStore(t)
+	post := PostData{Text: "hello", Timestamp: "2026-01-01T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/1"}
+
+	if err := store.Put("did:plc:abc", post); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	has, err := store.Has(post.Uri)
+	if err != nil {
+		t.Fatalf("Has: %v", err)
+	}
+	if !has {
+		t.Fatal("Has() = false after Put, want true")
+	}
+
+	if err := store.Delete("did:plc:abc", post.Uri); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	has, err = store.Has(post.Uri)
+	if err != nil {
+		t.Fatalf("Has: %v", err)
+	}
+	if has {
+		t.Fatal("Has() = true after Delete, want false")
+	}
+}
+
+func TestBoltPostStoreByDidReturnsOldestFirst(t *testing.T) {
+	store := newTestStore(t)
+	did := "did:plc:abc"
+
+	posts := []PostData{
+		{Text: "third", Timestamp: "2026-01-03T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/3"},
+		{Text: "first", Timestamp: "2026-01-01T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/1"},
+		{Text: "second", Timestamp: "2026-01-02T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/2"},
+	}
+	for _, post := range posts {
+		if err := store.Put(did, post); err != nil {
+			t.Fatalf("Put(%s): %v", post.Uri, err)
+		}
+	}
+
+	got, err := store.ByDid(did)
+	if err != nil {
+		t.Fatalf("ByDid: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("ByDid returned %d posts, want 3", len(got))
+	}
+	want := []string{"first", "second", "third"}
+	for i, post := range got {
+		if post.Text != want[i] {
+			t.Errorf("ByDid()[%d].Text = %q, want %q (not oldest-first)", i, post.Text, want[i])
+		}
+	}
+}
+
+func TestBoltPostStoreByDidSkipsDeletedPosts(t *testing.T) {
+	store := newTestStore(t)
+	did := "did:plc:abc"
+	keep := PostData{Text: "keep", Timestamp: "2026-01-01T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/keep"}
+	gone := PostData{Text: "gone", Timestamp: "2026-01-02T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/gone"}
+
+	if err := store.Put(did, keep); err != nil {
+		t.Fatalf("Put(keep): %v", err)
+	}
+	if err := store.Put(did, gone); err != nil {
+		t.Fatalf("Put(gone): %v", err)
+	}
+	if err := store.Delete(did, gone.Uri); err != nil {
+		t.Fatalf("Delete(gone): %v", err)
+	}
+
+	got, err := store.ByDid(did)
+	if err != nil {
+		t.Fatalf("ByDid: %v", err)
+	}
+	if len(got) != 1 || got[0].Uri != keep.Uri {
+		t.Fatalf("ByDid() = %v, want only %v", got, keep)
+	}
+}
+
+func TestBoltPostStoreCompactPreservesData(t *testing.T) {
+	store := newTestStore(t)
+	did := "did:plc:abc"
+	post := PostData{Text: "hello", Timestamp: "2026-01-01T00:00:00Z", Uri: "at://did:plc:abc/app.bsky.feed.post/1"}
+
+	if err := store.Put(did, post); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	has, err := store.Has(post.Uri)
+	if err != nil {
+		t.Fatalf("Has after Compact: %v", err)
+	}
+	if !has {
+		t.Fatal("Has() = false after Compact, want true")
+	}
+
+	got, err := store.ByDid(did)
+	if err != nil {
+		t.Fatalf("ByDid after Compact: %v", err)
+	}
+	if len(got) != 1 || got[0].Uri != post.Uri {
+		t.Fatalf("ByDid() after Compact = %v, want only %v", got, post)
+	}
+}
+
+func TestBoltPostStoreWebhookSubscriptions(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.AddWebhook("https://example.com/hook"); err != nil {
+		t.Fatalf("AddWebhook: %v", err)
+	}
+
+	urls, err := store.ListWebhooks()
+	if err != nil {
+		t.Fatalf("ListWebhooks: %v", err)
+	}
+	if len(urls) != 1 || urls[0] != "https://example.com/hook" {
+		t.Fatalf("ListWebhooks() = %v, want [https://example.com/hook]", urls)
+	}
+
+	if err := store.RemoveWebhook("https://example.com/hook"); err != nil {
+		t.Fatalf("RemoveWebhook: %v", err)
+	}
+
+	urls, err = store.ListWebhooks()
+	if err != nil {
+		t.Fatalf("ListWebhooks: %v", err)
+	}
+	if len(urls) != 0 {
+		t.Fatalf("ListWebhooks() after RemoveWebhook = %v, want empty", urls)
+	}
+}